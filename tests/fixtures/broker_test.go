@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryBrokerDeliversToAllSubscribers(t *testing.T) {
+	b := NewMemoryBroker()
+
+	got := make(chan string, 2)
+	for _, name := range []string{"a", "b"} {
+		name := name
+		if _, err := b.Subscribe("topic", func(ctx context.Context, topic string, msg []byte) error {
+			got <- name + ":" + string(msg)
+			return nil
+		}); err != nil {
+			t.Fatalf("Subscribe(%q) error: %v", name, err)
+		}
+	}
+
+	if err := b.Publish(context.Background(), "topic", []byte("hi")); err != nil {
+		t.Fatalf("Publish error: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-got:
+			seen[msg] = true
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for subscriber delivery")
+		}
+	}
+	if !seen["a:hi"] || !seen["b:hi"] {
+		t.Fatalf("got %v, want both a:hi and b:hi", seen)
+	}
+}
+
+func TestMemoryBrokerDropOldestDoesNotBlockPublisher(t *testing.T) {
+	b := NewMemoryBroker()
+	sub, err := b.Subscribe("topic", func(ctx context.Context, topic string, msg []byte) error {
+		return nil
+	}, WithQueueSize(1), WithDropOldest())
+	if err != nil {
+		t.Fatalf("Subscribe error: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			if err := b.Publish(context.Background(), "topic", []byte("msg")); err != nil {
+				t.Errorf("Publish error: %v", err)
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish with WithDropOldest blocked instead of dropping")
+	}
+}
+
+func TestMemoryBrokerConcurrentPublishersDeliverAllMessages(t *testing.T) {
+	b := NewMemoryBroker()
+	const publishers = 5
+	const perPublisher = 20
+	const total = publishers * perPublisher
+
+	got := make(chan string, total)
+	if _, err := b.Subscribe("topic", func(ctx context.Context, topic string, msg []byte) error {
+		got <- string(msg)
+		return nil
+	}, WithQueueSize(total)); err != nil {
+		t.Fatalf("Subscribe error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for p := 0; p < publishers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perPublisher; i++ {
+				msg := fmt.Sprintf("%d:%d", p, i)
+				if err := b.Publish(context.Background(), "topic", []byte(msg)); err != nil {
+					t.Errorf("Publish(%q) error: %v", msg, err)
+				}
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	seen := make(map[string]int, total)
+	for i := 0; i < total; i++ {
+		select {
+		case msg := <-got:
+			seen[msg]++
+		case <-time.After(time.Second):
+			t.Fatalf("timed out after %d/%d deliveries", i, total)
+		}
+	}
+	if len(seen) != total {
+		t.Fatalf("got %d distinct messages, want %d", len(seen), total)
+	}
+	for msg, count := range seen {
+		if count != 1 {
+			t.Errorf("message %q delivered %d times, want exactly 1", msg, count)
+		}
+	}
+}
+
+func TestMemoryBrokerPublishBlocksUntilSlowSubscriberDrains(t *testing.T) {
+	b := NewMemoryBroker()
+	proceed := make(chan struct{})
+	var handled int32
+	sub, err := b.Subscribe("topic", func(ctx context.Context, topic string, msg []byte) error {
+		atomic.AddInt32(&handled, 1)
+		<-proceed
+		return nil
+	}, WithQueueSize(0))
+	if err != nil {
+		t.Fatalf("Subscribe error: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	// Rendezvous with the subscriber's first receive; the handler then
+	// blocks on proceed, leaving the subscriber unable to accept another
+	// message until it's closed.
+	if err := b.Publish(context.Background(), "topic", []byte("1")); err != nil {
+		t.Fatalf("Publish(1) error: %v", err)
+	}
+
+	publishDone := make(chan error, 1)
+	go func() {
+		publishDone <- b.Publish(context.Background(), "topic", []byte("2"))
+	}()
+
+	select {
+	case <-publishDone:
+		t.Fatal("Publish returned before the slow subscriber drained the first message")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(proceed)
+
+	select {
+	case err := <-publishDone:
+		if err != nil {
+			t.Fatalf("Publish(2) error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Publish did not unblock once the subscriber drained")
+	}
+	if atomic.LoadInt32(&handled) < 1 {
+		t.Fatal("handler never ran")
+	}
+}
+
+func TestMemoryBrokerPublishUnblocksOnContextDone(t *testing.T) {
+	b := NewMemoryBroker()
+	block := make(chan struct{})
+	sub, err := b.Subscribe("topic", func(ctx context.Context, topic string, msg []byte) error {
+		<-block
+		return nil
+	}, WithQueueSize(0))
+	if err != nil {
+		t.Fatalf("Subscribe error: %v", err)
+	}
+	defer func() {
+		close(block)
+		sub.Unsubscribe()
+	}()
+
+	// Rendezvous with the first receive so the handler is the one blocking,
+	// not an empty queue.
+	if err := b.Publish(context.Background(), "topic", []byte("1")); err != nil {
+		t.Fatalf("Publish(1) error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	publishDone := make(chan error, 1)
+	go func() {
+		publishDone <- b.Publish(ctx, "topic", []byte("2"))
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-publishDone:
+		if err != context.Canceled {
+			t.Fatalf("got %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Publish did not return after ctx was canceled")
+	}
+}
+
+func TestMemoryBrokerPublishStopsAfterUnsubscribeDuringDelivery(t *testing.T) {
+	b := NewMemoryBroker()
+	block := make(chan struct{})
+	sub, err := b.Subscribe("topic", func(ctx context.Context, topic string, msg []byte) error {
+		<-block
+		return nil
+	}, WithQueueSize(0))
+	if err != nil {
+		t.Fatalf("Subscribe error: %v", err)
+	}
+
+	// Rendezvous with the first receive so the handler is already blocked
+	// inside block when we unsubscribe mid-delivery of the second message.
+	if err := b.Publish(context.Background(), "topic", []byte("1")); err != nil {
+		t.Fatalf("Publish(1) error: %v", err)
+	}
+
+	publishDone := make(chan error, 1)
+	go func() {
+		publishDone <- b.Publish(context.Background(), "topic", []byte("2"))
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	sub.Unsubscribe()
+
+	select {
+	case err := <-publishDone:
+		if err != nil {
+			t.Fatalf("Publish error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Publish did not return after Unsubscribe fired mid-delivery")
+	}
+	close(block)
+}
+
+func TestMemoryBrokerPublishStopsAfterUnsubscribe(t *testing.T) {
+	b := NewMemoryBroker()
+	sub, err := b.Subscribe("topic", func(ctx context.Context, topic string, msg []byte) error {
+		return nil
+	}, WithQueueSize(0))
+	if err != nil {
+		t.Fatalf("Subscribe error: %v", err)
+	}
+	sub.Unsubscribe()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := b.Publish(context.Background(), "topic", []byte("msg")); err != nil {
+			t.Errorf("Publish error: %v", err)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on an unsubscribed subscriber")
+	}
+}
+
+func TestWebhookBrokerPublishContinuesPastSubscriberError(t *testing.T) {
+	var delivered int32
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&delivered, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ok.Close()
+
+	// An unreachable URL makes client.Do fail, exercising the transport-level
+	// error path; it must not stop delivery to the remaining subscriber.
+	b := NewWebhookBroker(nil)
+	if _, err := b.Subscribe("topic", nil, WithWebhookURL("http://127.0.0.1:0")); err != nil {
+		t.Fatalf("Subscribe(unreachable) error: %v", err)
+	}
+	if _, err := b.Subscribe("topic", nil, WithWebhookURL(ok.URL)); err != nil {
+		t.Fatalf("Subscribe(ok) error: %v", err)
+	}
+
+	if err := b.Publish(context.Background(), "topic", []byte("hi")); err == nil {
+		t.Fatal("expected an error from the unreachable subscriber, got nil")
+	}
+	if got := atomic.LoadInt32(&delivered); got != 1 {
+		t.Fatalf("got %d deliveries to the healthy subscriber, want 1", got)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCallRoundTripsThroughInProcessTransport(t *testing.T) {
+	s := &Server{}
+	mustRegister(t, s, "echo/Upper", func(ctx context.Context, req []byte) ([]byte, error) {
+		return []byte(fmt.Sprintf("got:%s", req)), nil
+	})
+
+	c := NewClient(NewInProcessTransport(s))
+	c.Codec = RawCodec{}
+	rsp, err := Call[[]byte, []byte](context.Background(), c, Request[[]byte]{
+		Service: "echo", Method: "Upper", Body: []byte(`"hi"`),
+	})
+	if err != nil {
+		t.Fatalf("Call error: %v", err)
+	}
+	if string(rsp) != `got:"hi"` {
+		t.Fatalf("got %q, want %q", rsp, `got:"hi"`)
+	}
+}
+
+func TestCallAsyncDeliversExactlyOnce(t *testing.T) {
+	s := &Server{}
+	mustRegister(t, s, "svc/Method", echoHandler)
+
+	c := NewClient(NewInProcessTransport(s))
+	out := CallAsync[[]byte, []byte](context.Background(), c, Request[[]byte]{
+		Service: "svc", Method: "Method", Body: []byte(`"x"`),
+	})
+
+	select {
+	case rsp, ok := <-out:
+		if !ok {
+			t.Fatal("channel closed before delivering a result")
+		}
+		if rsp.Err != nil {
+			t.Fatalf("unexpected error: %v", rsp.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for CallAsync result")
+	}
+
+	if _, ok := <-out; ok {
+		t.Fatal("channel delivered a second value")
+	}
+}
+
+func TestStreamCallDeliversMultipleChunksInProcess(t *testing.T) {
+	s := &Server{}
+	s.RegisterStream("svc/Tail", func(ctx context.Context, req []byte, send func([]byte) error) error {
+		for i := 0; i < 3; i++ {
+			if err := send([]byte(fmt.Sprintf(`"chunk%d"`, i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	c := NewClient(NewInProcessTransport(s))
+	stream, err := StreamCall[[]byte, string](context.Background(), c, Request[[]byte]{
+		Service: "svc", Method: "Tail", Body: []byte(`"req"`),
+	})
+	if err != nil {
+		t.Fatalf("StreamCall error: %v", err)
+	}
+
+	var got []string
+	for {
+		item, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv error: %v", err)
+		}
+		got = append(got, item)
+	}
+
+	want := []string{"chunk0", "chunk1", "chunk2"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestStreamCallSurfacesHandlerError(t *testing.T) {
+	s := &Server{}
+	s.RegisterStream("svc/Fail", func(ctx context.Context, req []byte, send func([]byte) error) error {
+		if err := send([]byte(`"one"`)); err != nil {
+			return err
+		}
+		return fmt.Errorf("boom")
+	})
+
+	c := NewClient(NewInProcessTransport(s))
+	stream, err := StreamCall[[]byte, string](context.Background(), c, Request[[]byte]{
+		Service: "svc", Method: "Fail", Body: []byte(`"req"`),
+	})
+	if err != nil {
+		t.Fatalf("StreamCall error: %v", err)
+	}
+
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Recv error on first chunk: %v", err)
+	}
+	if _, err := stream.Recv(); err == nil || err == io.EOF {
+		t.Fatalf("got %v, want the handler's error", err)
+	}
+}
+
+func TestStreamCallFallsBackToSingleItemForNonStreamingTransport(t *testing.T) {
+	s := &Server{}
+	mustRegister(t, s, "svc/Once", echoHandler)
+
+	c := NewClient(nonStreamingTransport{NewInProcessTransport(s)})
+	stream, err := StreamCall[[]byte, []byte](context.Background(), c, Request[[]byte]{
+		Service: "svc", Method: "Once", Body: []byte(`"hi"`),
+	})
+	if err != nil {
+		t.Fatalf("StreamCall error: %v", err)
+	}
+
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Recv error: %v", err)
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Fatalf("got %v, want io.EOF after the single item", err)
+	}
+}
+
+// nonStreamingTransport wraps a Transport without exposing OpenStream, so
+// StreamCall's fallback path is exercised regardless of whether the
+// wrapped transport happens to support streaming.
+type nonStreamingTransport struct {
+	Transport
+}
+
+func TestTCPTransportRoundTripHonorsContextCancellation(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen error: %v", err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan struct{})
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		close(accepted)
+		// Read the header but never respond, holding the client blocked
+		// on its response read until it's canceled.
+		buf := make([]byte, 256)
+		conn.Read(buf)
+		<-time.After(5 * time.Second)
+	}()
+
+	transport := NewTCPTransport(time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := transport.RoundTrip(ctx, ln.Addr().String(), "svc", "Method", []byte("body"))
+		done <- err
+	}()
+
+	select {
+	case <-accepted:
+	case <-time.After(time.Second):
+		t.Fatal("server never accepted the connection")
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected an error after canceling ctx, got nil")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("RoundTrip did not return after ctx was canceled")
+	}
+}
+
+func TestTCPTransportOpenStreamDeliversFramesAndEnd(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen error: %v", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := make([]byte, 4096)
+		n, _ := conn.Read(reader)
+		_ = n // header + length-prefixed body; contents unused by this stub.
+
+		writeFrame := func(kind byte, payload []byte) {
+			conn.Write([]byte{kind})
+			if kind != streamFrameEnd {
+				binary.Write(conn, binary.BigEndian, uint32(len(payload)))
+				conn.Write(payload)
+			}
+		}
+		writeFrame(streamFrameData, []byte(`"a"`))
+		writeFrame(streamFrameData, []byte(`"b"`))
+		writeFrame(streamFrameEnd, nil)
+	}()
+
+	transport := NewTCPTransport(time.Second)
+	frames, err := transport.OpenStream(context.Background(), ln.Addr().String(), "svc", "Method", []byte("body"))
+	if err != nil {
+		t.Fatalf("OpenStream error: %v", err)
+	}
+
+	var got []string
+	for frame := range frames {
+		if frame.Err != nil {
+			t.Fatalf("unexpected frame error: %v", frame.Err)
+		}
+		got = append(got, string(frame.Body))
+	}
+
+	want := []string{`"a"`, `"b"`}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
@@ -8,10 +8,19 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 /* ── Constants and variables ──────────────────────────────────────────── */
@@ -37,15 +46,32 @@ const (
 // Server represents an HTTP server with host and port configuration.
 // It embeds sync.Mutex for concurrent access protection.
 type Server struct {
-	Port int    // Port number the server listens on.
-	Host string // Hostname or IP address to bind to.
-	sync.Mutex  // Embedded mutex for thread-safe operations.
-	handlers map[string]HandlerFunc // Route handler registry.
+	Port           int                          // Port number the server listens on.
+	Host           string                       // Hostname or IP address to bind to.
+	sync.Mutex                                  // Embedded mutex for thread-safe operations.
+	router         *routeNode                   // Trie-based route registry.
+	routerMu       sync.RWMutex                 // Guards router's trie against concurrent insert/lookup.
+	middleware     []Middleware                 // Chain applied to every Register'd handler.
+	broker         Broker                       // Pub/sub broker used by RegisterSubscriber.
+	streamHandlers map[string]StreamHandlerFunc // Exact-path registry for RegisterStream.
 }
 
 // HandlerFunc defines the signature for HTTP request handlers.
 type HandlerFunc func(ctx context.Context, req []byte) ([]byte, error)
 
+// StreamHandlerFunc processes a streaming request, calling send once per
+// response chunk; returning a non-nil error ends the stream with that
+// error instead of a clean EOF.
+type StreamHandlerFunc func(ctx context.Context, req []byte, send func([]byte) error) error
+
+// Middleware wraps a HandlerFunc to add cross-cutting behavior such as
+// logging, recovery, or timeouts.
+type Middleware func(HandlerFunc) HandlerFunc
+
+// paramKey is the context key type under which route parameters captured
+// by the router are stored.
+type paramKey string
+
 // Embedded struct demonstrating composition over inheritance.
 type Address struct {
 	Street string // Street name and number.
@@ -55,9 +81,9 @@ type Address struct {
 
 // Employee composes Person-like fields with an embedded Address.
 type Employee struct {
-	Name    string  // Full name of the employee.
-	Age     int     // Age in years.
-	Address         // Embedded address (promoted fields).
+	Name    string    // Full name of the employee.
+	Age     int       // Age in years.
+	Address           // Embedded address (promoted fields).
 	Manager *Employee // Optional reference to reporting manager.
 }
 
@@ -127,15 +153,328 @@ func (s *Server) Start() error {
 	return nil
 }
 
-// Register adds a handler function for a specific route path.
+// Use appends middleware to the server's chain. Middleware registered
+// earlier wraps middleware registered later, so the first call to Use ends
+// up outermost around every handler registered afterward.
 // @receiver s Pointer to Server.
-// @param path The URL path to register.
+// @param mw One or more Middleware functions to append to the chain.
+func (s *Server) Use(mw ...Middleware) {
+	s.Lock()
+	defer s.Unlock()
+	s.middleware = append(s.middleware, mw...)
+}
+
+// Register adds a handler function for a specific route path, composing it
+// with the server's middleware chain (outer-most first) before inserting it
+// into the trie router. Insertion is synchronized via routerMu so it never
+// races a concurrent Dispatch's lookup.
+// @receiver s Pointer to Server.
+// @param path The URL path to register; may contain :param segments and a
+// trailing *wildcard segment.
 // @param handler The function to invoke for this path.
-func (s *Server) Register(path string, handler HandlerFunc) {
-	if s.handlers == nil {
-		s.handlers = make(map[string]HandlerFunc)
+// @return An error if path conflicts with a differently-named :param or
+// *wildcard, or with one of the other kind, already registered at the same
+// trie position.
+func (s *Server) Register(path string, handler HandlerFunc) error {
+	s.Lock()
+	middleware := append([]Middleware(nil), s.middleware...)
+	if s.router == nil {
+		s.router = &routeNode{}
+	}
+	router := s.router
+	s.Unlock()
+
+	chain := handler
+	for i := len(middleware) - 1; i >= 0; i-- {
+		chain = middleware[i](chain)
+	}
+
+	s.routerMu.Lock()
+	defer s.routerMu.Unlock()
+	return router.insert(path, chain)
+}
+
+// Dispatch matches path against the registered trie and invokes the bound
+// handler with req, making the router testable without a real network
+// listener. The lookup is synchronized via routerMu so it never races a
+// concurrent Register's insert.
+// @receiver s Pointer to Server.
+// @param ctx Context passed through to the matched handler; route
+// parameters are attached to it via paramKey.
+// @param path Request path to match against registered routes.
+// @param req Raw request payload passed to the handler.
+// @return Handler response, or an error if no route matches.
+func (s *Server) Dispatch(ctx context.Context, path string, req []byte) ([]byte, error) {
+	s.Lock()
+	router := s.router
+	s.Unlock()
+	if router == nil {
+		return nil, fmt.Errorf("dispatch: no routes registered")
+	}
+
+	s.routerMu.RLock()
+	handler, params := router.lookup(path)
+	s.routerMu.RUnlock()
+
+	if handler == nil {
+		return nil, fmt.Errorf("dispatch: no route for %q", path)
+	}
+	for name, value := range params {
+		ctx = context.WithValue(ctx, paramKey(name), value)
+	}
+	return handler(ctx, req)
+}
+
+// RegisterStream adds a streaming handler for path, invoked by
+// DispatchStream. Unlike Register, path is matched exactly: streaming
+// routes don't go through the trie router and so don't support :param or
+// *wildcard segments.
+// @receiver s Pointer to Server.
+// @param path The exact path StreamCall/DispatchStream will look up.
+// @param handler The streaming function to invoke for this path.
+func (s *Server) RegisterStream(path string, handler StreamHandlerFunc) {
+	s.Lock()
+	defer s.Unlock()
+	if s.streamHandlers == nil {
+		s.streamHandlers = make(map[string]StreamHandlerFunc)
+	}
+	s.streamHandlers[path] = handler
+}
+
+// DispatchStream looks up the streaming handler registered for path and
+// runs it, invoking send once per response chunk the handler produces.
+// @receiver s Pointer to Server.
+// @param ctx Context passed through to the matched handler.
+// @param path Request path to match against RegisterStream'd routes.
+// @param req Raw request payload passed to the handler.
+// @param send Callback invoked with each response chunk, in order.
+// @return An error if no route matches path, or the error the handler
+// itself returned.
+func (s *Server) DispatchStream(ctx context.Context, path string, req []byte, send func([]byte) error) error {
+	s.Lock()
+	handler, ok := s.streamHandlers[path]
+	s.Unlock()
+	if !ok {
+		return fmt.Errorf("dispatch stream: no route for %q", path)
+	}
+	return handler(ctx, req, send)
+}
+
+// SetBroker attaches a Broker to the server for use by RegisterSubscriber.
+// @receiver s Pointer to Server.
+// @param b Broker implementation to use for event-driven flows.
+func (s *Server) SetBroker(b Broker) {
+	s.Lock()
+	defer s.Unlock()
+	s.broker = b
+}
+
+// RegisterSubscriber subscribes h to topic on the server's broker, letting
+// the same Server handle both request/response (Register) and event-driven
+// (Publish/Subscribe) flows.
+// @receiver s Pointer to Server.
+// @param topic Topic name to subscribe to.
+// @param h Handler invoked for each message delivered on topic.
+// @return The resulting Subscription, or an error if no broker is set.
+func (s *Server) RegisterSubscriber(topic string, h SubHandler) (Subscription, error) {
+	s.Lock()
+	broker := s.broker
+	s.Unlock()
+	if broker == nil {
+		return nil, fmt.Errorf("register subscriber: no broker configured")
+	}
+	return broker.Subscribe(topic, h)
+}
+
+/* ── Trie-based router ────────────────────────────────────────────────── */
+
+// routeNode is a single node in the trie-based router. A path is matched
+// segment by segment, preferring a literal child, then a :param child, then
+// a trailing *wildcard child.
+type routeNode struct {
+	children     map[string]*routeNode
+	param        *routeNode
+	paramName    string
+	wildcard     *routeNode
+	wildcardName string
+	handler      HandlerFunc
+}
+
+// insert adds handler at path, creating intermediate nodes as needed. A
+// :param or *wildcard segment is bound to the node's single param/wildcard
+// child; registering a different name at a position that already has one
+// is a conflict (it would otherwise silently rename the existing route's
+// captured parameter) and is rejected. A :param and a *wildcard can't
+// coexist at the same position either: registering one where the other
+// already exists is rejected as well.
+// @param path Route path; segments starting with ':' bind a param, a
+// segment starting with '*' binds the remaining path and must be last.
+// @param handler Composed handler to store at the terminal node.
+// @return An error if path conflicts with an existing :param or *wildcard
+// name, or the other kind, at the same trie position.
+func (n *routeNode) insert(path string, handler HandlerFunc) error {
+	cur := n
+	for _, seg := range splitPath(path) {
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			name := seg[1:]
+			if cur.wildcard != nil {
+				return fmt.Errorf("router: path %q conflicts with existing wildcard %q at this position", path, cur.wildcard.wildcardName)
+			}
+			if cur.param == nil {
+				cur.param = &routeNode{paramName: name}
+			} else if cur.param.paramName != name {
+				return fmt.Errorf("router: path %q conflicts with existing param %q at this position (got %q)", path, cur.param.paramName, name)
+			}
+			cur = cur.param
+		case strings.HasPrefix(seg, "*"):
+			name := seg[1:]
+			if cur.param != nil {
+				return fmt.Errorf("router: path %q conflicts with existing param %q at this position", path, cur.param.paramName)
+			}
+			if cur.wildcard == nil {
+				cur.wildcard = &routeNode{wildcardName: name}
+			} else if cur.wildcard.wildcardName != name {
+				return fmt.Errorf("router: path %q conflicts with existing wildcard %q at this position (got %q)", path, cur.wildcard.wildcardName, name)
+			}
+			cur = cur.wildcard
+		default:
+			if cur.children == nil {
+				cur.children = make(map[string]*routeNode)
+			}
+			child, ok := cur.children[seg]
+			if !ok {
+				child = &routeNode{}
+				cur.children[seg] = child
+			}
+			cur = child
+		}
+	}
+	cur.handler = handler
+	return nil
+}
+
+// lookup walks the trie for path, returning the matched handler and any
+// captured path parameters.
+// @param path Request path to match.
+// @return Matched handler (nil if no route matches) and captured params.
+func (n *routeNode) lookup(path string) (HandlerFunc, map[string]string) {
+	return n.match(splitPath(path))
+}
+
+// match recursively tries a literal child, then a :param child, then a
+// trailing *wildcard child, backtracking to the next option whenever a
+// choice's subtree fails to produce a handler. Without this backtracking, a
+// literal child chosen for one segment would commit the whole match to that
+// subtree even when a sibling :param/*wildcard further up would have
+// matched, silently dropping otherwise-valid requests.
+// @param segments Remaining path segments to match, innermost call first.
+// @return Matched handler (nil if nothing under n matches) and captured
+// params, populated as the recursion unwinds.
+func (n *routeNode) match(segments []string) (HandlerFunc, map[string]string) {
+	if len(segments) == 0 {
+		if n.handler == nil {
+			return nil, nil
+		}
+		return n.handler, map[string]string{}
+	}
+
+	seg, rest := segments[0], segments[1:]
+
+	if child, ok := n.children[seg]; ok {
+		if handler, params := child.match(rest); handler != nil {
+			return handler, params
+		}
+	}
+	if n.param != nil {
+		if handler, params := n.param.match(rest); handler != nil {
+			params[n.param.paramName] = seg
+			return handler, params
+		}
+	}
+	if n.wildcard != nil && n.wildcard.handler != nil {
+		// A wildcard always binds the rest of the path rather than
+		// recursing segment by segment.
+		return n.wildcard.handler, map[string]string{n.wildcard.wildcardName: strings.Join(segments, "/")}
+	}
+	return nil, nil
+}
+
+// splitPath trims leading/trailing slashes and splits path into segments.
+func splitPath(path string) []string {
+	trimmed := strings.Trim(path, "/")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "/")
+}
+
+/* ── Built-in middlewares ─────────────────────────────────────────────── */
+
+// RecoveryMiddleware recovers from panics in the wrapped handler, converting
+// them to errors the same way SafeExecute does.
+func RecoveryMiddleware() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req []byte) (resp []byte, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic: %v", r)
+				}
+			}()
+			return next(ctx, req)
+		}
+	}
+}
+
+// LoggingMiddleware logs each request at the given level, using the
+// LogDebug/LogInfo/LogError constants to control verbosity.
+// @param level One of LogDebug, LogInfo, LogError.
+func LoggingMiddleware(level int) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req []byte) ([]byte, error) {
+			resp, err := next(ctx, req)
+			switch level {
+			case LogDebug:
+				fmt.Printf("[debug] request of %d bytes, err=%v\n", len(req), err)
+			case LogInfo:
+				fmt.Printf("[info] handled request, err=%v\n", err)
+			case LogError:
+				if err != nil {
+					fmt.Printf("[error] %v\n", err)
+				}
+			}
+			return resp, err
+		}
+	}
+}
+
+// TimeoutMiddleware bounds handler execution to d, scoping ctx with a
+// deadline for the duration of the call.
+// @param d Maximum duration allowed for the wrapped handler to complete.
+func TimeoutMiddleware(d time.Duration) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req []byte) ([]byte, error) {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			type outcome struct {
+				resp []byte
+				err  error
+			}
+			done := make(chan outcome, 1)
+			go func() {
+				resp, err := next(ctx, req)
+				done <- outcome{resp, err}
+			}()
+
+			select {
+			case o := <-done:
+				return o.resp, o.err
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
 	}
-	s.handlers[path] = handler
 }
 
 /* ── Generic function ─────────────────────────────────────────────────── */
@@ -210,34 +549,933 @@ func Counter() func() int {
 
 /* ── Goroutine and channels ───────────────────────────────────────────── */
 
-// FanOut distributes work across n goroutines via channels.
+// FanOut distributes work across n goroutines using a bounded Pool, so each
+// item is processed exactly once regardless of worker count.
 // @param items Slice of strings to process.
 // @param workers Number of concurrent worker goroutines.
 // @return Channel delivering processed results.
 func FanOut(items []string, workers int) <-chan string {
+	pool := NewPool(workers, len(items), func(ctx context.Context, item string) (string, error) {
+		return fmt.Sprintf("processed: %s", item), nil
+	})
+
 	results := make(chan string, len(items))
 	var wg sync.WaitGroup
-
-	for i := 0; i < workers; i++ {
+	for _, item := range items {
 		wg.Add(1)
-		go func(id int) {
+		go func(item string) {
 			defer wg.Done()
-			// Each worker processes items from the slice
-			for _, item := range items {
-				results <- fmt.Sprintf("[%d] %s", id, item)
+			if res, err := pool.Submit(item); err == nil {
+				results <- res
 			}
-		}(i)
+		}(item)
 	}
 
-	// Close channel when all workers finish
+	// Close the pool and the results channel once every item has landed.
 	go func() {
 		wg.Wait()
+		pool.Close()
 		close(results)
 	}()
 
 	return results
 }
 
+/* ── Worker pool ──────────────────────────────────────────────────────── */
+
+// QueuePolicy controls how Submit/SubmitCtx behave when a Pool's queue is
+// full.
+type QueuePolicy int
+
+const (
+	// QueueBlock blocks the caller until queue space is available or the
+	// job's context is done.
+	QueueBlock QueuePolicy = iota
+	// QueueReject returns ErrQueueFull immediately instead of blocking.
+	QueueReject
+)
+
+// ErrQueueFull is returned by Submit/SubmitCtx when QueueReject is set and
+// the queue has no free slot.
+var ErrQueueFull = fmt.Errorf("pool: queue is full")
+
+// ErrPoolClosed is returned by Submit/SubmitCtx once the pool's Close has
+// been called.
+var ErrPoolClosed = fmt.Errorf("pool: closed")
+
+// WorkFunc processes a single input and produces a result or an error.
+type WorkFunc[T, R any] func(ctx context.Context, input T) (R, error)
+
+// poolJob pairs a unit of work with the context it was submitted under and
+// the channel used to deliver its outcome back to the submitter.
+type poolJob[T, R any] struct {
+	ctx   context.Context
+	input T
+	resCh chan poolResult[R]
+}
+
+// poolResult carries a worker's output or error back to the submitter.
+type poolResult[R any] struct {
+	value R
+	err   error
+}
+
+// Pool is a reusable bounded worker pool that dispatches jobs of type T to a
+// fixed number of goroutines, each producing a result of type R.
+type Pool[T, R any] struct {
+	jobs      chan poolJob[T, R]
+	work      WorkFunc[T, R]
+	policy    QueuePolicy
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	mu        sync.RWMutex // Guards closed against a concurrent Close.
+	closed    bool
+}
+
+// NewPool starts a Pool with the given number of workers, a queue holding up
+// to queueSize pending jobs, and the work function each worker runs.
+// @param workers Number of concurrent worker goroutines; clamped to 1.
+// @param queueSize Capacity of the buffered jobs channel; clamped to 0.
+// @param work Function applied to each submitted input.
+// @return A started Pool ready to accept Submit/SubmitCtx calls.
+func NewPool[T, R any](workers, queueSize int, work WorkFunc[T, R]) *Pool[T, R] {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	p := &Pool[T, R]{
+		jobs:   make(chan poolJob[T, R], queueSize),
+		work:   work,
+		policy: QueueBlock,
+	}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.runWorker()
+	}
+	return p
+}
+
+// WithQueuePolicy sets the backpressure policy applied when the queue is
+// full and returns the Pool to allow chaining after NewPool.
+// @param policy QueueBlock or QueueReject.
+func (p *Pool[T, R]) WithQueuePolicy(policy QueuePolicy) *Pool[T, R] {
+	p.policy = policy
+	return p
+}
+
+// runWorker ranges over jobs until the queue is closed, running each job's
+// context check before handing it to the pool's WorkFunc.
+func (p *Pool[T, R]) runWorker() {
+	defer p.wg.Done()
+	for j := range p.jobs {
+		if err := j.ctx.Err(); err != nil {
+			j.resCh <- poolResult[R]{err: err}
+			continue
+		}
+		value, err := p.work(j.ctx, j.input)
+		j.resCh <- poolResult[R]{value: value, err: err}
+	}
+}
+
+// Submit enqueues input under a background context and blocks until the
+// corresponding worker returns a result or error.
+// @param input Value to process.
+// @return Result produced by the pool's work function, or an error.
+func (p *Pool[T, R]) Submit(input T) (R, error) {
+	return p.SubmitCtx(context.Background(), input)
+}
+
+// SubmitCtx enqueues input under ctx, applying the pool's queue policy when
+// the queue is full and honoring ctx's deadline/cancellation while queueing
+// and while waiting for the result.
+// @param ctx Context governing queueing and execution of the job.
+// @param input Value to process.
+// @return Result produced by the pool's work function, or an error.
+func (p *Pool[T, R]) SubmitCtx(ctx context.Context, input T) (R, error) {
+	var zero R
+
+	// Held for the enqueue only, so Close can't close p.jobs while a send
+	// to it is in flight.
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return zero, ErrPoolClosed
+	}
+	resCh := make(chan poolResult[R], 1)
+	j := poolJob[T, R]{ctx: ctx, input: input, resCh: resCh}
+
+	if p.policy == QueueReject {
+		select {
+		case p.jobs <- j:
+		default:
+			p.mu.RUnlock()
+			return zero, ErrQueueFull
+		}
+	} else {
+		select {
+		case p.jobs <- j:
+		case <-ctx.Done():
+			p.mu.RUnlock()
+			return zero, ctx.Err()
+		}
+	}
+	p.mu.RUnlock()
+
+	select {
+	case res := <-resCh:
+		return res.value, res.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// Close stops accepting new jobs and blocks until all queued and in-flight
+// jobs have drained. It is safe to call concurrently with Submit/SubmitCtx.
+func (p *Pool[T, R]) Close() {
+	p.closeOnce.Do(func() {
+		p.mu.Lock()
+		p.closed = true
+		close(p.jobs)
+		p.mu.Unlock()
+	})
+	p.wg.Wait()
+}
+
+/* ── Pub/sub broker ───────────────────────────────────────────────────── */
+
+// SubHandler processes a single message delivered on a subscribed topic.
+type SubHandler func(ctx context.Context, topic string, msg []byte) error
+
+// Subscription represents an active subscription created by Broker.Subscribe.
+type Subscription interface {
+	// Topic returns the topic this subscription was created for.
+	Topic() string
+	// Unsubscribe stops delivery of further messages to this subscription.
+	Unsubscribe()
+}
+
+// Broker is the interface implemented by pub/sub transports, sharing
+// Server's context.Context-first style for every blocking call.
+type Broker interface {
+	Connect() error
+	Disconnect() error
+	Publish(ctx context.Context, topic string, msg []byte, opts ...PubOption) error
+	Subscribe(topic string, h SubHandler, opts ...SubOption) (Subscription, error)
+}
+
+// PubOption configures a single Publish call.
+type PubOption func(*pubConfig)
+
+// pubConfig holds the options accumulated from PubOption values.
+type pubConfig struct{}
+
+// SubOption configures a single Subscribe call.
+type SubOption func(*subConfig)
+
+// subConfig holds the options accumulated from SubOption values.
+type subConfig struct {
+	queueSize  int
+	dropOldest bool
+	webhookURL string
+}
+
+// WithQueueSize sets a subscriber's bounded queue size.
+// @param n Maximum number of undelivered messages held for the subscriber.
+func WithQueueSize(n int) SubOption {
+	return func(c *subConfig) { c.queueSize = n }
+}
+
+// WithDropOldest makes a full subscriber queue drop the oldest queued
+// message instead of blocking the publisher.
+func WithDropOldest() SubOption {
+	return func(c *subConfig) { c.dropOldest = true }
+}
+
+// WithWebhookURL sets the URL WebhookBroker POSTs messages to for a
+// subscription; required when subscribing through WebhookBroker.
+func WithWebhookURL(url string) SubOption {
+	return func(c *subConfig) { c.webhookURL = url }
+}
+
+/* ── In-memory broker ─────────────────────────────────────────────────── */
+
+// memorySubscription is the Subscription returned by MemoryBroker.Subscribe.
+type memorySubscription struct {
+	topic      string
+	msgs       chan []byte
+	dropOldest bool
+	done       chan struct{}
+	once       sync.Once
+}
+
+func (s *memorySubscription) Topic() string { return s.topic }
+
+func (s *memorySubscription) Unsubscribe() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// MemoryBroker is an in-process Broker that fans published messages out to
+// subscribers over bounded per-subscriber queues.
+type MemoryBroker struct {
+	mu   sync.Mutex
+	subs map[string][]*memorySubscription
+}
+
+// NewMemoryBroker creates a ready-to-use MemoryBroker.
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{subs: make(map[string][]*memorySubscription)}
+}
+
+func (b *MemoryBroker) Connect() error    { return nil }
+func (b *MemoryBroker) Disconnect() error { return nil }
+
+// Publish delivers msg to every live subscriber of topic. A subscriber
+// configured with WithDropOldest drops its oldest queued message to make
+// room instead of blocking the publisher; otherwise Publish blocks until
+// the subscriber's queue has space, the subscription is unsubscribed, or
+// ctx is done.
+// @param ctx Context bounding how long Publish waits on a blocking
+// subscriber.
+// @param topic Topic to deliver msg to.
+// @param msg Message payload.
+func (b *MemoryBroker) Publish(ctx context.Context, topic string, msg []byte, opts ...PubOption) error {
+	cfg := &pubConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	b.mu.Lock()
+	subs := append([]*memorySubscription(nil), b.subs[topic]...)
+	b.mu.Unlock()
+
+	for _, sub := range subs {
+		select {
+		case <-sub.done:
+			continue
+		default:
+		}
+
+		if sub.dropOldest {
+			select {
+			case sub.msgs <- msg:
+			default:
+				select {
+				case <-sub.msgs:
+				default:
+				}
+				select {
+				case sub.msgs <- msg:
+				default:
+				}
+			}
+			continue
+		}
+
+		select {
+		case sub.msgs <- msg:
+		case <-sub.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Subscribe registers h to receive messages published to topic, delivering
+// them from a dedicated goroutine reading off a bounded queue.
+// @param topic Topic to subscribe to.
+// @param h Handler invoked for each delivered message.
+func (b *MemoryBroker) Subscribe(topic string, h SubHandler, opts ...SubOption) (Subscription, error) {
+	cfg := &subConfig{queueSize: 16}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	sub := &memorySubscription{
+		topic:      topic,
+		msgs:       make(chan []byte, cfg.queueSize),
+		dropOldest: cfg.dropOldest,
+		done:       make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	b.subs[topic] = append(b.subs[topic], sub)
+	b.mu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case msg := <-sub.msgs:
+				// select picks at random when both cases are ready, so
+				// recheck done to drop messages still queued at Unsubscribe.
+				select {
+				case <-sub.done:
+					return
+				default:
+				}
+				_ = h(context.Background(), topic, msg)
+			case <-sub.done:
+				return
+			}
+		}
+	}()
+
+	return sub, nil
+}
+
+/* ── Webhook broker ───────────────────────────────────────────────────── */
+
+// webhookSubscription is the Subscription returned by WebhookBroker.Subscribe.
+type webhookSubscription struct {
+	topic string
+	url   string
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (s *webhookSubscription) Topic() string { return s.topic }
+
+func (s *webhookSubscription) Unsubscribe() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// WebhookBroker is a stub Broker that delivers published messages by POSTing
+// them to subscriber URLs over HTTP.
+type WebhookBroker struct {
+	mu     sync.Mutex
+	client *http.Client
+	subs   map[string][]*webhookSubscription
+}
+
+// NewWebhookBroker creates a WebhookBroker that delivers messages using
+// client, falling back to http.DefaultClient when client is nil.
+func NewWebhookBroker(client *http.Client) *WebhookBroker {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &WebhookBroker{client: client, subs: make(map[string][]*webhookSubscription)}
+}
+
+func (b *WebhookBroker) Connect() error    { return nil }
+func (b *WebhookBroker) Disconnect() error { return nil }
+
+// Publish POSTs msg to every subscriber URL registered for topic. A failed
+// delivery to one subscriber does not stop delivery to the others; their
+// errors are collected and returned together.
+func (b *WebhookBroker) Publish(ctx context.Context, topic string, msg []byte, opts ...PubOption) error {
+	b.mu.Lock()
+	subs := append([]*webhookSubscription(nil), b.subs[topic]...)
+	b.mu.Unlock()
+
+	var errs []error
+	for _, sub := range subs {
+		select {
+		case <-sub.done:
+			continue
+		default:
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.url, bytes.NewReader(msg))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		resp, err := b.client.Do(req)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		resp.Body.Close()
+	}
+	return errors.Join(errs...)
+}
+
+// Subscribe registers a webhook URL, supplied via WithWebhookURL, to
+// receive topic deliveries. h is accepted to satisfy the Broker interface
+// but is unused: delivery happens over HTTP rather than by invoking h
+// in-process.
+// @param topic Topic to subscribe to.
+func (b *WebhookBroker) Subscribe(topic string, h SubHandler, opts ...SubOption) (Subscription, error) {
+	cfg := &subConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.webhookURL == "" {
+		return nil, fmt.Errorf("webhook broker: subscribe requires WithWebhookURL")
+	}
+
+	sub := &webhookSubscription{topic: topic, url: cfg.webhookURL, done: make(chan struct{})}
+	b.mu.Lock()
+	b.subs[topic] = append(b.subs[topic], sub)
+	b.mu.Unlock()
+	return sub, nil
+}
+
+/* ── Generic RPC client ───────────────────────────────────────────────── */
+
+// Request is a generic RPC request envelope.
+// @tparam Req Request body type.
+type Request[Req any] struct {
+	Service string
+	Method  string
+	Body    Req
+}
+
+// Response is a generic RPC response envelope.
+// @tparam Rsp Response body type.
+type Response[Rsp any] struct {
+	Body Rsp
+	Err  error
+}
+
+// Codec encodes and decodes call bodies for a Transport.
+type Codec interface {
+	Encode(v any) ([]byte, error)
+	Decode(data []byte, v any) error
+}
+
+// JSONCodec encodes bodies as JSON.
+type JSONCodec struct{}
+
+func (JSONCodec) Encode(v any) ([]byte, error) { return json.Marshal(v) }
+
+func (JSONCodec) Decode(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// RawCodec passes a []byte body through unchanged.
+type RawCodec struct{}
+
+func (RawCodec) Encode(v any) ([]byte, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("raw codec: expected []byte, got %T", v)
+	}
+	return b, nil
+}
+
+func (RawCodec) Decode(data []byte, v any) error {
+	p, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("raw codec: expected *[]byte, got %T", v)
+	}
+	*p = data
+	return nil
+}
+
+// Transport performs a single encoded round trip against addr.
+type Transport interface {
+	RoundTrip(ctx context.Context, addr, service, method string, body []byte) ([]byte, error)
+}
+
+// StreamFrame is one message delivered over a StreamingTransport's stream.
+// A non-nil Err is always the last frame received before the channel
+// closes; Body is only meaningful when Err is nil.
+type StreamFrame struct {
+	Body []byte
+	Err  error
+}
+
+// StreamingTransport is implemented by Transports that can open a
+// multi-message stream in addition to a single RoundTrip. StreamCall uses
+// it when the Client's Transport supports it, falling back to a one-item
+// Stream built from Call otherwise.
+type StreamingTransport interface {
+	Transport
+	OpenStream(ctx context.Context, addr, service, method string, body []byte) (<-chan StreamFrame, error)
+}
+
+// InProcessTransport dispatches directly to a local Server's router,
+// bypassing the network for in-process calls.
+type InProcessTransport struct {
+	server *Server
+}
+
+// NewInProcessTransport wraps server for in-process Client calls.
+func NewInProcessTransport(server *Server) *InProcessTransport {
+	return &InProcessTransport{server: server}
+}
+
+// RoundTrip dispatches the call to the wrapped Server's router, joining
+// service and method into the path Register/Dispatch expect.
+func (t *InProcessTransport) RoundTrip(ctx context.Context, addr, service, method string, body []byte) ([]byte, error) {
+	return t.server.Dispatch(ctx, service+"/"+method, body)
+}
+
+// OpenStream dispatches the call to the wrapped Server's streaming router,
+// delivering each chunk the handler sends on the returned channel.
+func (t *InProcessTransport) OpenStream(ctx context.Context, addr, service, method string, body []byte) (<-chan StreamFrame, error) {
+	frames := make(chan StreamFrame, 1)
+	go func() {
+		defer close(frames)
+		err := t.server.DispatchStream(ctx, service+"/"+method, body, func(chunk []byte) error {
+			select {
+			case frames <- StreamFrame{Body: chunk}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil {
+			select {
+			case frames <- StreamFrame{Err: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return frames, nil
+}
+
+// TCPTransport performs a simple length-prefixed request/response exchange
+// over a new TCP connection per call.
+type TCPTransport struct {
+	dialTimeout time.Duration
+}
+
+// NewTCPTransport creates a TCPTransport with the given dial timeout.
+func NewTCPTransport(dialTimeout time.Duration) *TCPTransport {
+	return &TCPTransport{dialTimeout: dialTimeout}
+}
+
+// closeOnCancel force-closes conn as soon as ctx is done, unblocking any
+// read or write already in flight on it. The caller must invoke the
+// returned stop func once conn is no longer needed, or this leaks a
+// goroutine until ctx is done.
+func closeOnCancel(ctx context.Context, conn net.Conn) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// ctxOr returns ctx.Err() if ctx is done, on the assumption that err was
+// caused by closeOnCancel force-closing the connection; otherwise it
+// returns err unchanged.
+func ctxOr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// RoundTrip dials addr, writes a "service/method\n" header followed by a
+// 4-byte big-endian length and the body, then reads a length-prefixed
+// response the same way. ctx is honored for the dial as well as every
+// subsequent write and read.
+func (t *TCPTransport) RoundTrip(ctx context.Context, addr, service, method string, body []byte) ([]byte, error) {
+	dialer := net.Dialer{Timeout: t.dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	stop := closeOnCancel(ctx, conn)
+	defer stop()
+
+	if _, err := fmt.Fprintf(conn, "%s/%s\n", service, method); err != nil {
+		return nil, ctxOr(ctx, err)
+	}
+	if err := binary.Write(conn, binary.BigEndian, uint32(len(body))); err != nil {
+		return nil, ctxOr(ctx, err)
+	}
+	if _, err := conn.Write(body); err != nil {
+		return nil, ctxOr(ctx, err)
+	}
+
+	var n uint32
+	if err := binary.Read(conn, binary.BigEndian, &n); err != nil {
+		return nil, ctxOr(ctx, err)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, ctxOr(ctx, err)
+	}
+	return resp, nil
+}
+
+// Frame kinds used by TCPTransport.OpenStream's wire protocol, sent as a
+// single byte ahead of each frame.
+const (
+	streamFrameData byte = iota
+	streamFrameEnd
+	streamFrameError
+)
+
+// OpenStream dials addr and sends the request the same way RoundTrip does,
+// then reads back a sequence of frames: each is a 1-byte kind followed, for
+// streamFrameData and streamFrameError, by a 4-byte big-endian length and
+// payload. A streamFrameEnd frame ends the stream cleanly; a
+// streamFrameError frame's payload is the remote error's message. ctx is
+// honored for the dial, the request write, and every subsequent read.
+func (t *TCPTransport) OpenStream(ctx context.Context, addr, service, method string, body []byte) (<-chan StreamFrame, error) {
+	dialer := net.Dialer{Timeout: t.dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := closeOnCancel(ctx, conn)
+
+	if _, err := fmt.Fprintf(conn, "%s/%s\n", service, method); err != nil {
+		stop()
+		conn.Close()
+		return nil, ctxOr(ctx, err)
+	}
+	if err := binary.Write(conn, binary.BigEndian, uint32(len(body))); err != nil {
+		stop()
+		conn.Close()
+		return nil, ctxOr(ctx, err)
+	}
+	if _, err := conn.Write(body); err != nil {
+		stop()
+		conn.Close()
+		return nil, ctxOr(ctx, err)
+	}
+
+	frames := make(chan StreamFrame, 1)
+	go func() {
+		defer stop()
+		defer conn.Close()
+		defer close(frames)
+		for {
+			var kind [1]byte
+			if _, err := io.ReadFull(conn, kind[:]); err != nil {
+				frames <- StreamFrame{Err: ctxOr(ctx, err)}
+				return
+			}
+			switch kind[0] {
+			case streamFrameEnd:
+				return
+			case streamFrameData, streamFrameError:
+				var n uint32
+				if err := binary.Read(conn, binary.BigEndian, &n); err != nil {
+					frames <- StreamFrame{Err: ctxOr(ctx, err)}
+					return
+				}
+				payload := make([]byte, n)
+				if _, err := io.ReadFull(conn, payload); err != nil {
+					frames <- StreamFrame{Err: ctxOr(ctx, err)}
+					return
+				}
+				if kind[0] == streamFrameError {
+					frames <- StreamFrame{Err: fmt.Errorf("stream: %s", payload)}
+					return
+				}
+				select {
+				case frames <- StreamFrame{Body: payload}:
+				case <-ctx.Done():
+					frames <- StreamFrame{Err: ctx.Err()}
+					return
+				}
+			default:
+				frames <- StreamFrame{Err: fmt.Errorf("stream: unknown frame kind %d", kind[0])}
+				return
+			}
+		}
+	}()
+	return frames, nil
+}
+
+// Selector picks one address from a set of candidates for load-balancing.
+type Selector func(addrs []string) string
+
+// RoundRobinSelector returns a Selector that cycles through addrs in order
+// across successive calls.
+func RoundRobinSelector() Selector {
+	var next uint64
+	return func(addrs []string) string {
+		if len(addrs) == 0 {
+			return ""
+		}
+		i := atomic.AddUint64(&next, 1) - 1
+		return addrs[i%uint64(len(addrs))]
+	}
+}
+
+// Client is the caller-side counterpart to Server, dispatching generic
+// requests through a pluggable Codec and Transport.
+type Client struct {
+	Addrs       []string
+	Transport   Transport
+	Codec       Codec
+	Selector    Selector
+	MaxRetries  int
+	BaseBackoff time.Duration
+}
+
+// NewClient creates a Client using JSONCodec and a round-robin Selector by
+// default.
+// @param transport Transport used to perform round trips.
+// @param addrs One or more addresses to select among for each call.
+func NewClient(transport Transport, addrs ...string) *Client {
+	return &Client{
+		Addrs:       addrs,
+		Transport:   transport,
+		Codec:       JSONCodec{},
+		Selector:    RoundRobinSelector(),
+		MaxRetries:  2,
+		BaseBackoff: 50 * time.Millisecond,
+	}
+}
+
+// addr picks the next address via the client's Selector.
+func (c *Client) addr() string {
+	if len(c.Addrs) == 0 {
+		return ""
+	}
+	return c.Selector(c.Addrs)
+}
+
+// Call performs a synchronous RPC, retrying with exponential backoff on
+// transport errors and honoring ctx's deadline/cancellation across all
+// attempts.
+// @tparam Req Request body type.
+// @tparam Rsp Response body type.
+// @param ctx Context governing the deadline and cancellation for all
+// attempts.
+// @param c Client to dispatch through.
+// @param req Request envelope to send.
+// @return Decoded response body, or an error.
+func Call[Req, Rsp any](ctx context.Context, c *Client, req Request[Req]) (Rsp, error) {
+	var zero Rsp
+	body, err := c.Codec.Encode(req.Body)
+	if err != nil {
+		return zero, err
+	}
+
+	var lastErr error
+	backoff := c.BaseBackoff
+	for attempt := 0; attempt <= c.MaxRetries; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return zero, err
+		}
+
+		respBody, err := c.Transport.RoundTrip(ctx, c.addr(), req.Service, req.Method, body)
+		if err == nil {
+			var rsp Rsp
+			if decErr := c.Codec.Decode(respBody, &rsp); decErr != nil {
+				return zero, decErr
+			}
+			return rsp, nil
+		}
+
+		lastErr = err
+		if attempt == c.MaxRetries {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		}
+	}
+	return zero, lastErr
+}
+
+// CallAsync runs Call in a background goroutine, delivering its result on
+// the returned channel exactly once.
+// @tparam Req Request body type.
+// @tparam Rsp Response body type.
+func CallAsync[Req, Rsp any](ctx context.Context, c *Client, req Request[Req]) <-chan Response[Rsp] {
+	out := make(chan Response[Rsp], 1)
+	go func() {
+		rsp, err := Call[Req, Rsp](ctx, c, req)
+		out <- Response[Rsp]{Body: rsp, Err: err}
+		close(out)
+	}()
+	return out
+}
+
+// Stream delivers the items produced by a streaming call, one per Recv
+// call, decoding each frame with the Client's Codec until the underlying
+// source is exhausted, closed, or returns an error.
+// @tparam Rsp Response body type.
+type Stream[Rsp any] struct {
+	frames <-chan StreamFrame
+	codec  Codec
+	cancel context.CancelFunc
+	closed bool
+}
+
+// Recv decodes and returns the next item, or io.EOF once the stream is
+// exhausted or closed. A remote-reported error is returned as-is.
+func (s *Stream[Rsp]) Recv() (Rsp, error) {
+	var zero Rsp
+	if s.closed {
+		return zero, io.EOF
+	}
+	frame, ok := <-s.frames
+	if !ok {
+		return zero, io.EOF
+	}
+	if frame.Err != nil {
+		return zero, frame.Err
+	}
+	var rsp Rsp
+	if err := s.codec.Decode(frame.Body, &rsp); err != nil {
+		return zero, err
+	}
+	return rsp, nil
+}
+
+// Close cancels the call underlying the stream, if it is still in flight,
+// and marks the stream exhausted; subsequent Recv calls return io.EOF.
+func (s *Stream[Rsp]) Close() error {
+	if !s.closed {
+		s.closed = true
+		s.cancel()
+	}
+	return nil
+}
+
+// StreamCall opens a streaming call and exposes the decoded responses as a
+// Stream. If c.Transport implements StreamingTransport, this is a genuine
+// multi-message stream; otherwise it falls back to a single Call and
+// exposes its one response as a one-item Stream.
+// @tparam Req Request body type.
+// @tparam Rsp Response body type.
+// @param ctx Context governing the call and the stream's lifetime;
+// canceling it, directly or via Stream.Close, stops delivery.
+func StreamCall[Req, Rsp any](ctx context.Context, c *Client, req Request[Req]) (*Stream[Rsp], error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	st, ok := c.Transport.(StreamingTransport)
+	if !ok {
+		rsp, err := Call[Req, Rsp](ctx, c, req)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		body, err := c.Codec.Encode(rsp)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		frames := make(chan StreamFrame, 1)
+		frames <- StreamFrame{Body: body}
+		close(frames)
+		return &Stream[Rsp]{frames: frames, codec: c.Codec, cancel: cancel}, nil
+	}
+
+	body, err := c.Codec.Encode(req.Body)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	frames, err := st.OpenStream(ctx, c.addr(), req.Service, req.Method, body)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &Stream[Rsp]{frames: frames, codec: c.Codec, cancel: cancel}, nil
+}
+
 /* ── Type switch ──────────────────────────────────────────────────────── */
 
 // Describe returns a description string for any value using type switch.
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFanOutProcessesEachItemExactlyOnce(t *testing.T) {
+	items := []string{"a", "b", "c", "d", "e"}
+	seen := make(map[string]int)
+	for res := range FanOut(items, 3) {
+		for _, item := range items {
+			if res == "processed: "+item {
+				seen[item]++
+			}
+		}
+	}
+	if len(seen) != len(items) {
+		t.Fatalf("got %d distinct items processed, want %d: %v", len(seen), len(items), seen)
+	}
+	for item, count := range seen {
+		if count != 1 {
+			t.Errorf("item %q processed %d times, want exactly 1", item, count)
+		}
+	}
+}
+
+func TestPoolCloseDrainsInFlightWork(t *testing.T) {
+	var started int32
+	release := make(chan struct{})
+	pool := NewPool(2, 4, func(ctx context.Context, n int) (int, error) {
+		atomic.AddInt32(&started, 1)
+		<-release
+		return n * 2, nil
+	})
+
+	results := make(chan int, 4)
+	var wg sync.WaitGroup
+	for i := 1; i <= 4; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			if res, err := pool.Submit(n); err == nil {
+				results <- res
+			}
+		}(i)
+	}
+
+	// Wait until both workers have picked up a job and the other two are
+	// queued behind them, so every Submit has enqueued before Close runs and
+	// none of them can be turned away with ErrPoolClosed.
+	for atomic.LoadInt32(&started) < 2 || len(pool.jobs) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+
+	done := make(chan struct{})
+	go func() {
+		pool.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not return after in-flight work finished")
+	}
+
+	wg.Wait()
+	close(results)
+
+	var got []int
+	for r := range results {
+		got = append(got, r)
+	}
+	sort.Ints(got)
+	want := []int{2, 4, 6, 8}
+	if len(got) != len(want) {
+		t.Fatalf("got %v results, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v results, want %v", got, want)
+		}
+	}
+}
+
+func TestPoolCloseRaceSafeAgainstConcurrentSubmit(t *testing.T) {
+	pool := NewPool(4, 1, func(ctx context.Context, n int) (int, error) {
+		return n, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			if _, err := pool.Submit(n); err != nil && err != ErrPoolClosed {
+				t.Errorf("Submit(%d) error: %v", n, err)
+			}
+		}(i)
+	}
+
+	pool.Close()
+	wg.Wait()
+}
+
+func TestPoolSubmitRejectsWhenQueueFullUnderQueueReject(t *testing.T) {
+	block := make(chan struct{})
+	working := make(chan struct{})
+	var once sync.Once
+	pool := NewPool(1, 1, func(ctx context.Context, n int) (int, error) {
+		once.Do(func() { close(working) })
+		<-block
+		return n, nil
+	}).WithQueuePolicy(QueueReject)
+
+	// Occupy the single worker and wait until it has actually started, so
+	// the queue slot behind it is empty and available for the next Submit.
+	firstDone := make(chan error, 1)
+	go func() {
+		_, err := pool.Submit(1)
+		firstDone <- err
+	}()
+	<-working
+
+	// Fill the one queue slot behind the busy worker.
+	queuedDone := make(chan error, 1)
+	go func() {
+		_, err := pool.Submit(2)
+		queuedDone <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// The worker is busy and the queue slot is taken, so QueueReject must
+	// fail fast instead of blocking for a third submission.
+	if _, err := pool.Submit(3); err != ErrQueueFull {
+		t.Fatalf("got err %v, want ErrQueueFull", err)
+	}
+
+	close(block)
+	if err := <-firstDone; err != nil {
+		t.Fatalf("first Submit error: %v", err)
+	}
+	if err := <-queuedDone; err != nil {
+		t.Fatalf("queued Submit error: %v", err)
+	}
+	pool.Close()
+}
+
+func TestPoolSubmitCtxAbortsQueuedJobOnCancel(t *testing.T) {
+	block := make(chan struct{})
+	working := make(chan struct{})
+	var once sync.Once
+	pool := NewPool(1, 0, func(ctx context.Context, n int) (int, error) {
+		once.Do(func() { close(working) })
+		<-block
+		return n, nil
+	})
+
+	// Occupy the single worker so the next submission has to queue, and
+	// wait until it has actually started before moving on; every goroutine
+	// below is fully joined before Close runs.
+	firstDone := make(chan error, 1)
+	go func() {
+		_, err := pool.Submit(1)
+		firstDone <- err
+	}()
+	<-working
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queued := make(chan error, 1)
+	go func() {
+		_, err := pool.SubmitCtx(ctx, 2)
+		queued <- err
+	}()
+
+	// Give the second submission a moment to reach its blocking send
+	// before canceling; if it hasn't, ctx.Done() is already the only
+	// ready case once cancel fires, so the outcome is the same either way.
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-queued:
+		if err != context.Canceled {
+			t.Fatalf("got err %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SubmitCtx did not return after ctx was canceled")
+	}
+
+	close(block)
+	if err := <-firstDone; err != nil {
+		t.Fatalf("first Submit error: %v", err)
+	}
+	pool.Close()
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func echoHandler(ctx context.Context, req []byte) ([]byte, error) {
+	return req, nil
+}
+
+func mustRegister(t *testing.T, s *Server, path string, h HandlerFunc) {
+	t.Helper()
+	if err := s.Register(path, h); err != nil {
+		t.Fatalf("Register(%q) error: %v", path, err)
+	}
+}
+
+func TestDispatchParamExtraction(t *testing.T) {
+	cases := []struct {
+		name       string
+		route      string
+		path       string
+		wantParams map[string]string
+	}{
+		{"single param", "/users/:id", "/users/42", map[string]string{"id": "42"}},
+		{"multi segment wildcard", "/static/*path", "/static/css/site.css", map[string]string{"path": "css/site.css"}},
+		{"param and wildcard combined", "/repos/:owner/*rest", "/repos/acme/issues/7", map[string]string{"owner": "acme", "rest": "issues/7"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{}
+			var gotCtx context.Context
+			mustRegister(t, s, tc.route, func(ctx context.Context, req []byte) ([]byte, error) {
+				gotCtx = ctx
+				return req, nil
+			})
+			if _, err := s.Dispatch(context.Background(), tc.path, nil); err != nil {
+				t.Fatalf("Dispatch(%q) error: %v", tc.path, err)
+			}
+			for name, want := range tc.wantParams {
+				got, _ := gotCtx.Value(paramKey(name)).(string)
+				if got != want {
+					t.Errorf("param %q = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDispatchPrefersLiteralOverParam(t *testing.T) {
+	s := &Server{}
+	var which string
+	mustRegister(t, s, "/users/:id", func(ctx context.Context, req []byte) ([]byte, error) {
+		which = "param"
+		return nil, nil
+	})
+	mustRegister(t, s, "/users/me", func(ctx context.Context, req []byte) ([]byte, error) {
+		which = "literal"
+		return nil, nil
+	})
+
+	if _, err := s.Dispatch(context.Background(), "/users/me", nil); err != nil {
+		t.Fatalf("Dispatch error: %v", err)
+	}
+	if which != "literal" {
+		t.Fatalf("got %q, want the literal route to win", which)
+	}
+
+	which = ""
+	if _, err := s.Dispatch(context.Background(), "/users/42", nil); err != nil {
+		t.Fatalf("Dispatch error: %v", err)
+	}
+	if which != "param" {
+		t.Fatalf("got %q, want the param route for a non-literal segment", which)
+	}
+}
+
+func TestRegisterRejectsConflictingParamNames(t *testing.T) {
+	s := &Server{}
+	mustRegister(t, s, "/users/:id", echoHandler)
+
+	if err := s.Register("/users/:name/profile", echoHandler); err == nil {
+		t.Fatal("expected an error registering a conflicting param name, got nil")
+	}
+
+	// The original route's param binding must be unaffected by the
+	// rejected registration.
+	var gotCtx context.Context
+	mustRegister(t, s, "/users/:id", func(ctx context.Context, req []byte) ([]byte, error) {
+		gotCtx = ctx
+		return nil, nil
+	})
+	if _, err := s.Dispatch(context.Background(), "/users/42", nil); err != nil {
+		t.Fatalf("Dispatch error: %v", err)
+	}
+	if got, _ := gotCtx.Value(paramKey("id")).(string); got != "42" {
+		t.Errorf("ctx param %q, want %q", got, "42")
+	}
+}
+
+func TestRegisterRejectsParamWildcardConflict(t *testing.T) {
+	s := &Server{}
+	mustRegister(t, s, "/users/:id", echoHandler)
+
+	if err := s.Register("/users/*rest", echoHandler); err == nil {
+		t.Fatal("expected an error registering a wildcard where a param already exists, got nil")
+	}
+
+	s2 := &Server{}
+	mustRegister(t, s2, "/static/*path", echoHandler)
+
+	if err := s2.Register("/static/:name", echoHandler); err == nil {
+		t.Fatal("expected an error registering a param where a wildcard already exists, got nil")
+	}
+}
+
+func TestDispatchBacktracksPastDeadEndLiteral(t *testing.T) {
+	s := &Server{}
+	mustRegister(t, s, "/a/b/c", echoHandler)
+
+	var gotCtx context.Context
+	mustRegister(t, s, "/a/:x", func(ctx context.Context, req []byte) ([]byte, error) {
+		gotCtx = ctx
+		return nil, nil
+	})
+
+	if _, err := s.Dispatch(context.Background(), "/a/b", nil); err != nil {
+		t.Fatalf("Dispatch error: %v", err)
+	}
+	if got, _ := gotCtx.Value(paramKey("x")).(string); got != "b" {
+		t.Errorf("param %q = %q, want %q", "x", got, "b")
+	}
+}
+
+func TestUseComposesOutermostFirst(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, req []byte) ([]byte, error) {
+				order = append(order, "before:"+name)
+				resp, err := next(ctx, req)
+				order = append(order, "after:"+name)
+				return resp, err
+			}
+		}
+	}
+
+	s := &Server{}
+	s.Use(mw("outer"), mw("inner"))
+	mustRegister(t, s, "/ping", echoHandler)
+
+	if _, err := s.Dispatch(context.Background(), "/ping", nil); err != nil {
+		t.Fatalf("Dispatch error: %v", err)
+	}
+
+	want := []string{"before:outer", "before:inner", "after:inner", "after:outer"}
+	if len(order) != len(want) {
+		t.Fatalf("got %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("got %v, want %v", order, want)
+		}
+	}
+}
+
+func TestRecoveryMiddlewareConvertsPanicToError(t *testing.T) {
+	s := &Server{}
+	s.Use(RecoveryMiddleware())
+	mustRegister(t, s, "/boom", func(ctx context.Context, req []byte) ([]byte, error) {
+		panic("kaboom")
+	})
+
+	_, err := s.Dispatch(context.Background(), "/boom", nil)
+	if err == nil {
+		t.Fatal("expected an error from the recovered panic, got nil")
+	}
+	if !strings.Contains(err.Error(), "kaboom") {
+		t.Errorf("error %v does not mention the panic value", err)
+	}
+}
+
+func TestConcurrentRegisterAndDispatch(t *testing.T) {
+	s := &Server{}
+	mustRegister(t, s, "/warm", echoHandler)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_ = s.Register(fmt.Sprintf("/route%d", i), echoHandler)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_, _ = s.Dispatch(context.Background(), "/warm", nil)
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+}